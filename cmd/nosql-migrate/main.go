@@ -0,0 +1,65 @@
+// Command nosql-migrate copies every bucket from one nosql database.DB
+// driver to another, e.g. `nosql-migrate --from badgerv1 --from-dsn ...
+// --to postgresql --to-dsn ...`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/surajt6/nosql"
+	"github.com/surajt6/nosql/migrate"
+)
+
+func main() {
+	var (
+		fromDriver = flag.String("from", "", "source driver (badger, badgerv1, badgerv2, bbolt, mysql, postgresql, sqlite)")
+		fromDSN    = flag.String("from-dsn", "", "source data source name")
+		toDriver   = flag.String("to", "", "destination driver")
+		toDSN      = flag.String("to-dsn", "", "destination data source name")
+		batchSize  = flag.Int("batch-size", 500, "number of entries per destination transaction")
+		skip       = flag.Bool("skip-existing", false, "leave existing destination keys untouched instead of overwriting them")
+	)
+	flag.Parse()
+
+	if *fromDriver == "" || *fromDSN == "" || *toDriver == "" || *toDSN == "" {
+		fmt.Fprintln(os.Stderr, "usage: nosql-migrate --from driver --from-dsn dsn --to driver --to-dsn dsn")
+		os.Exit(2)
+	}
+
+	src, err := nosql.New(*fromDriver, *fromDSN)
+	if err != nil {
+		fatalf("failed to open source database: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := nosql.New(*toDriver, *toDSN)
+	if err != nil {
+		fatalf("failed to open destination database: %v", err)
+	}
+	defer dst.Close()
+
+	onSkip := migrate.Overwrite
+	if *skip {
+		onSkip = migrate.Skip
+	}
+
+	stats, err := migrate.Copy(src, dst, migrate.MigrateOptions{
+		BatchSize: *batchSize,
+		OnSkip:    onSkip,
+		Progress: func(s migrate.Stats) {
+			fmt.Printf("\rbuckets=%d copied=%d skipped=%d errors=%d", s.Buckets, s.Copied, s.Skipped, s.Errors)
+		},
+	})
+	fmt.Println()
+	if err != nil {
+		fatalf("migration failed: %v", err)
+	}
+	fmt.Printf("done: %d buckets, %d entries copied, %d skipped, %d errors\n", stats.Buckets, stats.Copied, stats.Skipped, stats.Errors)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
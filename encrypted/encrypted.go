@@ -0,0 +1,412 @@
+// Package encrypted wraps any database.DB and transparently encrypts
+// values, and optionally keys, at rest with AES-GCM.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/surajt6/nosql/database"
+)
+
+// envelopeVersion1 is the only envelope format this package currently
+// writes: {version:1, nonce:12B, ciphertext||tag}. The leading version
+// byte lets a future format change coexist with values written under this
+// one, and lets key rotation decrypt with the key that matches a given
+// envelope.
+const envelopeVersion1 byte = 1
+
+// encryptionMetaBucket holds the passphrase salt this DB was opened with,
+// so deriveKey reproduces the same key across restarts. It is created
+// lazily the first time New is called with a passphrase instead of a raw
+// key.
+var encryptionMetaBucket = []byte("_encryption_meta")
+
+var encryptionSaltKey = []byte("salt")
+
+// saltSize is 16 bytes (128 bits), the salt length RFC 9106 recommends
+// for Argon2; it is shorter than the 32-byte key deriveKey produces.
+const saltSize = 16
+
+// DB wraps an inner, already-open database.DB and encrypts every value
+// (and, if configured, every key) that crosses it with AES-GCM.
+type DB struct {
+	inner       database.DB
+	aead        cipher.AEAD
+	keyStream   cipher.Block
+	encryptKeys bool
+}
+
+// New wraps inner with an encryption layer. key must be a valid AES key of
+// 16, 24 or 32 bytes (32 selects AES-256-GCM); if it is empty, a key is derived from passphrase with
+// Argon2id, salted with a random value that's generated once and
+// persisted in inner's encryptionMetaBucket so later calls to New against
+// the same inner (e.g. after a restart) derive the same key. When
+// encryptKeys is true, bucket keys are also encrypted, using a
+// deterministic AES-CTR transform under a key independent of the value
+// AEAD's (rather than AES-GCM) so that encrypting the same plaintext key
+// twice yields the same ciphertext and point lookups keep working; this
+// means Scan/PrefixScan, which depend on keys sorting in a meaningful
+// order, return database.ErrOpNotSupported when key encryption is enabled.
+func New(inner database.DB, key []byte, passphrase string, encryptKeys bool) (*DB, error) {
+	if len(key) == 0 {
+		if passphrase == "" {
+			return nil, errors.New("encrypted: either an encryption key or a passphrase is required")
+		}
+		salt, err := saltFor(inner)
+		if err != nil {
+			return nil, err
+		}
+		key = deriveKey(passphrase, salt)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypted: invalid encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypted: failed to initialize AES-GCM")
+	}
+
+	keyStreamKey, err := deriveKeyStreamKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyStream, err := aes.NewCipher(keyStreamKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypted: failed to initialize key-encryption cipher")
+	}
+
+	return &DB{inner: inner, aead: aead, keyStream: keyStream, encryptKeys: encryptKeys}, nil
+}
+
+// deriveKey turns a passphrase into a 32-byte AES-256 key with Argon2id,
+// using parameters in line with OWASP's current minimum recommendation
+// (1 pass, 64 MiB, 4 lanes) so brute-forcing the passphrase costs real
+// time and memory instead of a bare SHA-256 per guess.
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+// deriveKeyStreamKey derives an independent key for the deterministic
+// key-encryption CTR transform from the value-encryption key via
+// HKDF-SHA256, so the two cipher constructions never share raw key
+// material even though they're derived from the same secret.
+func deriveKeyStreamKey(key []byte) ([]byte, error) {
+	sub := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, key, []byte("nosql/encrypted/key-stream")), sub); err != nil {
+		return nil, errors.Wrap(err, "encrypted: failed to derive key-encryption subkey")
+	}
+	return sub, nil
+}
+
+// saltFor loads the passphrase salt persisted in inner's
+// encryptionMetaBucket, generating and persisting a new random one the
+// first time it's called against a given inner database.
+func saltFor(inner database.DB) ([]byte, error) {
+	if err := inner.CreateTable(encryptionMetaBucket); err != nil {
+		return nil, errors.Wrap(err, "encrypted: failed to create encryption metadata bucket")
+	}
+
+	salt, err := inner.Get(encryptionMetaBucket, encryptionSaltKey)
+	switch {
+	case err == nil:
+		return salt, nil
+	case database.IsErrNotFound(err):
+		salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, errors.Wrap(err, "encrypted: failed to generate salt")
+		}
+		if err := inner.Set(encryptionMetaBucket, encryptionSaltKey, salt); err != nil {
+			return nil, errors.Wrap(err, "encrypted: failed to persist salt")
+		}
+		return salt, nil
+	default:
+		return nil, errors.Wrap(err, "encrypted: failed to load salt")
+	}
+}
+
+// Open implements database.DB. Encrypted DBs are constructed already-open
+// via New, which wraps an inner database.DB that nosql.New opened itself;
+// Open is a no-op kept only to satisfy the interface.
+func (db *DB) Open(dataSourceName string, opt ...database.Option) error {
+	return nil
+}
+
+// Close implements database.DB.
+func (db *DB) Close() error {
+	return db.inner.Close()
+}
+
+// CreateTable implements database.DB. Bucket names are never encrypted.
+func (db *DB) CreateTable(bucket []byte) error {
+	return db.inner.CreateTable(bucket)
+}
+
+// DeleteTable implements database.DB. Bucket names are never encrypted.
+func (db *DB) DeleteTable(bucket []byte) error {
+	return db.inner.DeleteTable(bucket)
+}
+
+// Buckets implements database.DB. It excludes encryptionMetaBucket, the
+// wrapper's own bookkeeping bucket, the same way sqlite.Buckets excludes
+// sqlite's internal tables: its value is a raw salt, not a version-1
+// envelope, so callers that walk every returned bucket (e.g. migrate.Copy)
+// would fail trying to decrypt it.
+func (db *DB) Buckets() ([][]byte, error) {
+	buckets, err := db.inner.Buckets()
+	if err != nil {
+		return nil, err
+	}
+	filtered := buckets[:0]
+	for _, bucket := range buckets {
+		if bytes.Equal(bucket, encryptionMetaBucket) {
+			continue
+		}
+		filtered = append(filtered, bucket)
+	}
+	return filtered, nil
+}
+
+// Get implements database.DB.
+func (db *DB) Get(bucket []byte, key []byte) ([]byte, error) {
+	sealed, err := db.inner.Get(bucket, db.sealKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return db.open(sealed)
+}
+
+// Set implements database.DB.
+func (db *DB) Set(bucket []byte, key []byte, value []byte) error {
+	sealedValue, err := db.seal(value)
+	if err != nil {
+		return err
+	}
+	return db.inner.Set(bucket, db.sealKey(key), sealedValue)
+}
+
+// Del implements database.DB.
+func (db *DB) Del(bucket []byte, key []byte) error {
+	return db.inner.Del(bucket, db.sealKey(key))
+}
+
+// List implements database.DB.
+func (db *DB) List(bucket []byte) ([]*database.Entry, error) {
+	sealed, err := db.inner.List(bucket)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*database.Entry, len(sealed))
+	for i, e := range sealed {
+		value, err := db.open(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decrypt %s/%s", bucket, e.Key)
+		}
+		entries[i] = &database.Entry{Bucket: bucket, Key: db.openKey(e.Key), Value: value}
+	}
+	return entries, nil
+}
+
+// Scan implements database.DB. It is only supported when key encryption
+// is disabled, since AES-CTR-encrypted keys carry no useful sort order.
+func (db *DB) Scan(bucket []byte, startKey []byte, endKey []byte, reverse bool, fn func(*database.Entry) error) error {
+	if bytes.Equal(bucket, encryptionMetaBucket) {
+		return errors.Wrapf(database.ErrOpNotSupported, "encrypted: %s is a reserved bucket", bucket)
+	}
+	if db.encryptKeys {
+		return errors.Wrap(database.ErrOpNotSupported, "encrypted: Scan requires key encryption to be disabled")
+	}
+	return db.inner.Scan(bucket, startKey, endKey, reverse, func(e *database.Entry) error {
+		value, err := db.open(e.Value)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt %s/%s", bucket, e.Key)
+		}
+		return fn(&database.Entry{Bucket: bucket, Key: e.Key, Value: value})
+	})
+}
+
+// PrefixScan implements database.DB.
+func (db *DB) PrefixScan(bucket []byte, prefix []byte, fn func(*database.Entry) error) error {
+	if bytes.Equal(bucket, encryptionMetaBucket) {
+		return errors.Wrapf(database.ErrOpNotSupported, "encrypted: %s is a reserved bucket", bucket)
+	}
+	if db.encryptKeys {
+		return errors.Wrap(database.ErrOpNotSupported, "encrypted: PrefixScan requires key encryption to be disabled")
+	}
+	return db.inner.PrefixScan(bucket, prefix, func(e *database.Entry) error {
+		value, err := db.open(e.Value)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt %s/%s", bucket, e.Key)
+		}
+		return fn(&database.Entry{Bucket: bucket, Key: e.Key, Value: value})
+	})
+}
+
+// CmpAndSwap implements database.DB. The stored value is decrypted and
+// compared against the caller's plaintext oldValue here, then the swap is
+// performed as a CmpOrRollback+Set pair against the *encrypted* current
+// value so a concurrent writer is still detected.
+func (db *DB) CmpAndSwap(bucket []byte, key []byte, oldValue []byte, newValue []byte) ([]byte, bool, error) {
+	sealedKey := db.sealKey(key)
+
+	sealedCurrent, err := db.inner.Get(bucket, sealedKey)
+	switch {
+	case database.IsErrNotFound(err):
+		sealedCurrent, err = nil, nil
+	case err != nil:
+		return nil, false, err
+	}
+
+	var current []byte
+	if sealedCurrent != nil {
+		if current, err = db.open(sealedCurrent); err != nil {
+			return nil, false, errors.Wrapf(err, "failed to decrypt %s/%s", bucket, key)
+		}
+	}
+	if !bytes.Equal(current, oldValue) {
+		return current, false, nil
+	}
+
+	sealedValue, err := db.seal(newValue)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = db.inner.Update(context.Background(), &database.Tx{Operations: []*database.TxEntry{
+		{Cmd: database.CmpOrRollback, Bucket: bucket, Key: sealedKey, CmpValue: sealedCurrent},
+		{Cmd: database.Set, Bucket: bucket, Key: sealedKey, Value: sealedValue},
+	}})
+	switch {
+	case errors.Is(err, database.ErrCmpFailed):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, errors.Wrapf(err, "failed to swap %s/%s", bucket, key)
+	default:
+		return newValue, true, nil
+	}
+}
+
+// Update implements database.DB. Get/Set/Delete/CreateTable/DeleteTable
+// are sealed and delegated to inner; mixing in CmpAndSwap/CmpOrRollback
+// isn't supported here since the atomic decrypt-then-compare dance that
+// CmpAndSwap performs can't be expressed against an opaque ciphertext
+// inside a larger transaction. Use the top-level CmpAndSwap method for
+// that instead.
+func (db *DB) Update(ctx context.Context, tx *database.Tx) error {
+	sealed := make([]*database.TxEntry, len(tx.Operations))
+	for i, q := range tx.Operations {
+		switch q.Cmd {
+		case database.Get, database.Delete, database.CreateTable, database.DeleteTable:
+			sealed[i] = &database.TxEntry{Cmd: q.Cmd, Bucket: q.Bucket, Key: db.sealKey(q.Key)}
+		case database.Set:
+			sealedValue, err := db.seal(q.Value)
+			if err != nil {
+				return err
+			}
+			sealed[i] = &database.TxEntry{Cmd: q.Cmd, Bucket: q.Bucket, Key: db.sealKey(q.Key), Value: sealedValue}
+		default:
+			return errors.Wrapf(database.ErrOpNotSupported, "encrypted: %s is not supported inside Update", q.Cmd)
+		}
+	}
+
+	if err := db.inner.Update(ctx, &database.Tx{Operations: sealed}); err != nil {
+		return err
+	}
+
+	for i, q := range tx.Operations {
+		if q.Cmd == database.Get {
+			value, err := db.open(sealed[i].Result)
+			if err != nil {
+				return errors.Wrapf(err, "failed to decrypt %s/%s", q.Bucket, q.Key)
+			}
+			q.Result = value
+		}
+	}
+	return nil
+}
+
+// View implements database.DB. Only Get operations are meaningful in a
+// read-only transaction, matching the underlying drivers.
+func (db *DB) View(ctx context.Context, tx *database.Tx) error {
+	sealed := make([]*database.TxEntry, len(tx.Operations))
+	for i, q := range tx.Operations {
+		if q.Cmd != database.Get {
+			return errors.Wrapf(database.ErrOpNotSupported, "%s is not allowed in a read-only View transaction", q.Cmd)
+		}
+		sealed[i] = &database.TxEntry{Cmd: database.Get, Bucket: q.Bucket, Key: db.sealKey(q.Key)}
+	}
+
+	if err := db.inner.View(ctx, &database.Tx{Operations: sealed}); err != nil {
+		return err
+	}
+
+	for i, q := range tx.Operations {
+		value, err := db.open(sealed[i].Result)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt %s/%s", q.Bucket, q.Key)
+		}
+		q.Result = value
+	}
+	return nil
+}
+
+func (db *DB) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, db.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "encrypted: failed to generate nonce")
+	}
+	envelope := make([]byte, 0, 1+len(nonce)+len(plaintext)+db.aead.Overhead())
+	envelope = append(envelope, envelopeVersion1)
+	envelope = append(envelope, nonce...)
+	envelope = db.aead.Seal(envelope, nonce, plaintext, nil)
+	return envelope, nil
+}
+
+func (db *DB) open(envelope []byte) ([]byte, error) {
+	nonceSize := db.aead.NonceSize()
+	if len(envelope) < 1+nonceSize {
+		return nil, errors.New("encrypted: envelope too short")
+	}
+	if envelope[0] != envelopeVersion1 {
+		return nil, errors.Errorf("encrypted: unsupported envelope version %d", envelope[0])
+	}
+	nonce := envelope[1 : 1+nonceSize]
+	ciphertext := envelope[1+nonceSize:]
+	return db.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// sealKey deterministically transforms key with AES-CTR (under the
+// independent db.keyStream key, and a zero IV) when key encryption is
+// enabled, so the same plaintext key always maps to the same ciphertext
+// and point lookups keep working. CTR is its own inverse, so openKey
+// reuses the same transform.
+func (db *DB) sealKey(key []byte) []byte {
+	if !db.encryptKeys || key == nil {
+		return key
+	}
+	return db.xorKeyStream(key)
+}
+
+func (db *DB) openKey(key []byte) []byte {
+	if !db.encryptKeys || key == nil {
+		return key
+	}
+	return db.xorKeyStream(key)
+}
+
+func (db *DB) xorKeyStream(key []byte) []byte {
+	out := make([]byte, len(key))
+	cipher.NewCTR(db.keyStream, make([]byte, db.keyStream.BlockSize())).XORKeyStream(out, key)
+	return out
+}
@@ -0,0 +1,290 @@
+package encrypted_test
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/surajt6/nosql/database"
+	"github.com/surajt6/nosql/encrypted"
+)
+
+// mockDB is a minimal in-memory database.DB used to exercise the
+// encrypted wrapper without a real driver.
+type mockDB struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func newMockDB() *mockDB {
+	return &mockDB{buckets: map[string]map[string][]byte{}}
+}
+
+func (m *mockDB) Open(string, ...database.Option) error { return nil }
+func (m *mockDB) Close() error                          { return nil }
+
+func (m *mockDB) CreateTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[string(bucket)] == nil {
+		m.buckets[string(bucket)] = map[string][]byte{}
+	}
+	return nil
+}
+
+func (m *mockDB) DeleteTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets, string(bucket))
+	return nil
+}
+
+func (m *mockDB) Buckets() ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buckets [][]byte
+	for name := range m.buckets {
+		buckets = append(buckets, []byte(name))
+	}
+	return buckets, nil
+}
+
+func (m *mockDB) Get(bucket, key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
+	}
+	return val, nil
+}
+
+func (m *mockDB) Set(bucket, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[string(bucket)] == nil {
+		m.buckets[string(bucket)] = map[string][]byte{}
+	}
+	m.buckets[string(bucket)][string(key)] = value
+	return nil
+}
+
+func (m *mockDB) Del(bucket, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets[string(bucket)], string(key))
+	return nil
+}
+
+func (m *mockDB) List(bucket []byte) ([]*database.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []*database.Entry
+	for key, value := range m.buckets[string(bucket)] {
+		entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(key), Value: value})
+	}
+	return entries, nil
+}
+
+func (m *mockDB) Scan(bucket, startKey, endKey []byte, reverse bool, fn func(*database.Entry) error) error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.buckets[string(bucket)]))
+	for key := range m.buckets[string(bucket)] {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+	sort.Strings(keys)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	for _, key := range keys {
+		if bytes.Compare([]byte(key), startKey) < 0 {
+			continue
+		}
+		if endKey != nil && bytes.Compare([]byte(key), endKey) >= 0 {
+			continue
+		}
+		m.mu.Lock()
+		value := m.buckets[string(bucket)][key]
+		m.mu.Unlock()
+		if err := fn(&database.Entry{Bucket: bucket, Key: []byte(key), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockDB) PrefixScan(bucket, prefix []byte, fn func(*database.Entry) error) error {
+	return m.Scan(bucket, prefix, nil, false, func(e *database.Entry) error {
+		if !bytes.HasPrefix(e.Key, prefix) {
+			return nil
+		}
+		return fn(e)
+	})
+}
+
+func (m *mockDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	current, err := m.Get(bucket, key)
+	if err != nil && !database.IsErrNotFound(err) {
+		return nil, false, err
+	}
+	if !bytes.Equal(current, oldValue) {
+		return current, false, nil
+	}
+	return newValue, true, m.Set(bucket, key, newValue)
+}
+
+func (m *mockDB) Update(ctx context.Context, tx *database.Tx) error {
+	for _, q := range tx.Operations {
+		switch q.Cmd {
+		case database.Set:
+			if err := m.Set(q.Bucket, q.Key, q.Value); err != nil {
+				return err
+			}
+		case database.Get:
+			val, err := m.Get(q.Bucket, q.Key)
+			if err != nil {
+				return err
+			}
+			q.Result = val
+		case database.CmpOrRollback:
+			current, err := m.Get(q.Bucket, q.Key)
+			if err != nil && !database.IsErrNotFound(err) {
+				return err
+			}
+			if !bytes.Equal(current, q.CmpValue) {
+				return database.ErrCmpFailed
+			}
+		default:
+			return database.ErrOpNotSupported
+		}
+	}
+	return nil
+}
+
+func (m *mockDB) View(ctx context.Context, tx *database.Tx) error {
+	for _, q := range tx.Operations {
+		if q.Cmd != database.Get {
+			return database.ErrOpNotSupported
+		}
+		val, err := m.Get(q.Bucket, q.Key)
+		if err != nil {
+			return err
+		}
+		q.Result = val
+	}
+	return nil
+}
+
+var bucketA = []byte("a")
+
+func TestRoundTrip(t *testing.T) {
+	inner := newMockDB()
+	if err := inner.CreateTable(bucketA); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	db, err := encrypted.New(inner, nil, "correct horse battery staple", true)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := db.Set(bucketA, []byte("k"), []byte("plaintext value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, err := db.Get(bucketA, []byte("k"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, []byte("plaintext value")) {
+		t.Fatalf("Get returned %q, want %q", got, "plaintext value")
+	}
+
+	// The inner store must never see the plaintext key or value.
+	for k, v := range inner.buckets[string(bucketA)] {
+		if k == "k" {
+			t.Fatalf("inner bucket stored the plaintext key %q", k)
+		}
+		if bytes.Contains(v, []byte("plaintext value")) {
+			t.Fatalf("inner bucket stored the plaintext value %q", v)
+		}
+	}
+}
+
+func TestPassphraseKeySurvivesReopen(t *testing.T) {
+	inner := newMockDB()
+	if err := inner.CreateTable(bucketA); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	first, err := encrypted.New(inner, nil, "s3cret", false)
+	if err != nil {
+		t.Fatalf("New (first open): %v", err)
+	}
+	if err := first.Set(bucketA, []byte("k"), []byte("v1")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Re-deriving the key against the same inner DB and passphrase (e.g.
+	// after a process restart) must reuse the persisted salt and recover
+	// the same key, not a fresh random one.
+	second, err := encrypted.New(inner, nil, "s3cret", false)
+	if err != nil {
+		t.Fatalf("New (second open): %v", err)
+	}
+	got, err := second.Get(bucketA, []byte("k"))
+	if err != nil {
+		t.Fatalf("Get after reopen: %v", err)
+	}
+	if !bytes.Equal(got, []byte("v1")) {
+		t.Fatalf("Get after reopen = %q, want %q", got, "v1")
+	}
+
+	// A different passphrase derives a different key and must not be
+	// able to decrypt values written under the first one.
+	wrong, err := encrypted.New(inner, nil, "wrong passphrase", false)
+	if err != nil {
+		t.Fatalf("New (wrong passphrase): %v", err)
+	}
+	if _, err := wrong.Get(bucketA, []byte("k")); err == nil {
+		t.Fatal("Get with the wrong passphrase unexpectedly succeeded")
+	}
+}
+
+// TestBucketsExcludesEncryptionMeta guards against a regression that broke
+// migrate.Copy: it walks every bucket Buckets() returns and Scans each, so
+// a leaked _encryption_meta bucket there makes it try to AES-GCM-decrypt a
+// raw salt as if it were a version-1 envelope.
+func TestBucketsExcludesEncryptionMeta(t *testing.T) {
+	inner := newMockDB()
+	if err := inner.CreateTable(bucketA); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	db, err := encrypted.New(inner, nil, "s3cret", false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := db.Set(bucketA, []byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	buckets, err := db.Buckets()
+	if err != nil {
+		t.Fatalf("Buckets: %v", err)
+	}
+	for _, bucket := range buckets {
+		if string(bucket) == "_encryption_meta" {
+			t.Fatalf("Buckets returned the reserved bucket %q", bucket)
+		}
+	}
+
+	if err := db.Scan(bucketA, nil, nil, false, func(*database.Entry) error { return nil }); err != nil {
+		t.Fatalf("Scan(bucketA): %v", err)
+	}
+	if err := db.Scan([]byte("_encryption_meta"), nil, nil, false, func(*database.Entry) error { return nil }); !database.IsErrOpNotSupported(err) {
+		t.Fatalf("Scan(_encryption_meta) = %v, want database.ErrOpNotSupported", err)
+	}
+}
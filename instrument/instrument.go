@@ -0,0 +1,260 @@
+// Package instrument wraps a database.DB with Prometheus metrics and
+// OpenTelemetry tracing. It stands in for the database.Instrument
+// decorator described for this driver-agnostic instrumentation layer;
+// the shared database package isn't part of this checkout, so it lives
+// here as its own subpackage instead.
+package instrument
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/surajt6/nosql/database"
+)
+
+// statsProvider is implemented by drivers (the SQL ones) that expose
+// their connection pool stats, keyed by pool name ("writer", "reader",
+// ...), as a map[string]sql.DBStats.
+type statsProvider interface {
+	Stats() interface{}
+}
+
+type options struct {
+	registerer     prometheus.Registerer
+	tracerProvider trace.TracerProvider
+}
+
+// Option configures the wrapper returned by Wrap.
+type Option func(*options)
+
+// WithMetricsRegisterer registers the wrapper's counters, histogram, and
+// gauges with reg instead of the default Prometheus registry.
+func WithMetricsRegisterer(reg prometheus.Registerer) Option {
+	return func(o *options) { o.registerer = reg }
+}
+
+// WithTracerProvider records every operation as a span from tp instead of
+// a no-op tracer.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) { o.tracerProvider = tp }
+}
+
+// db wraps an inner database.DB, recording a nosql_ops_total counter, a
+// nosql_op_duration_seconds histogram, and (for drivers with pool stats)
+// nosql_open_connections gauges around every call, plus a span per call.
+type db struct {
+	inner  database.DB
+	driver string
+	tracer trace.Tracer
+
+	opsTotal   *prometheus.CounterVec
+	opDuration *prometheus.HistogramVec
+	openConns  *prometheus.GaugeVec
+}
+
+// Wrap returns inner instrumented with Prometheus metrics and
+// OpenTelemetry spans. driver names the wrapped driver (e.g. "sqlite")
+// for the driver label on every metric and span.
+func Wrap(inner database.DB, driver string, opts ...Option) database.DB {
+	o := &options{
+		registerer:     prometheus.DefaultRegisterer,
+		tracerProvider: trace.NewNoopTracerProvider(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	w := &db{
+		inner:  inner,
+		driver: driver,
+		tracer: o.tracerProvider.Tracer("github.com/surajt6/nosql"),
+		opsTotal: registerOrReuse(o.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nosql_ops_total",
+			Help: "Total nosql operations, by driver, operation, bucket, and status.",
+		}, []string{"driver", "op", "bucket", "status"})).(*prometheus.CounterVec),
+		opDuration: registerOrReuse(o.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nosql_op_duration_seconds",
+			Help: "Latency of nosql operations, by driver, operation, and bucket.",
+		}, []string{"driver", "op", "bucket"})).(*prometheus.HistogramVec),
+		openConns: registerOrReuse(o.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nosql_open_connections",
+			Help: "Open SQL connections, by driver and pool.",
+		}, []string{"driver", "pool", "state"})).(*prometheus.GaugeVec),
+	}
+	return w
+}
+
+// registerOrReuse registers c with reg, same as MustRegister, except that
+// when c has already been registered (e.g. Wrap is called more than once
+// against the default registerer) it returns the previously registered
+// collector instead of panicking.
+func registerOrReuse(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	err := reg.Register(c)
+	switch are := err.(type) {
+	case nil:
+		return c
+	case prometheus.AlreadyRegisteredError:
+		return are.ExistingCollector
+	default:
+		panic(err)
+	}
+}
+
+// observe records a span, a latency observation, and an ops-total
+// increment around fn, which receives the span-decorated context so
+// tracing actually propagates to the wrapped call.
+func (w *db) observe(ctx context.Context, op string, bucket []byte, keyLen int, fn func(context.Context) error) error {
+	ctx, span := w.tracer.Start(ctx, "nosql."+op, trace.WithAttributes(
+		attribute.String("nosql.driver", w.driver),
+		attribute.String("nosql.bucket", string(bucket)),
+		attribute.Int("nosql.key_length", keyLen),
+	))
+	defer span.End()
+
+	start := time.Now()
+	err := fn(ctx)
+	w.opDuration.WithLabelValues(w.driver, op, string(bucket)).Observe(time.Since(start).Seconds())
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+		span.RecordError(err)
+	}
+	w.opsTotal.WithLabelValues(w.driver, op, string(bucket), status).Inc()
+	w.refreshConnGauges()
+	return err
+}
+
+func (w *db) refreshConnGauges() {
+	sp, ok := w.inner.(statsProvider)
+	if !ok {
+		return
+	}
+	stats, ok := sp.Stats().(map[string]sql.DBStats)
+	if !ok {
+		return
+	}
+	for pool, s := range stats {
+		w.openConns.WithLabelValues(w.driver, pool, "open").Set(float64(s.OpenConnections))
+		w.openConns.WithLabelValues(w.driver, pool, "in_use").Set(float64(s.InUse))
+		w.openConns.WithLabelValues(w.driver, pool, "idle").Set(float64(s.Idle))
+	}
+}
+
+// Stats surfaces the inner driver's pool stats, if any, for callers that
+// want them directly rather than through Prometheus.
+func (w *db) Stats() interface{} {
+	sp, ok := w.inner.(statsProvider)
+	if !ok {
+		return nil
+	}
+	return sp.Stats()
+}
+
+func (w *db) Open(dataSourceName string, opt ...database.Option) error {
+	return w.inner.Open(dataSourceName, opt...)
+}
+
+func (w *db) Close() error {
+	return w.inner.Close()
+}
+
+func (w *db) CreateTable(bucket []byte) (err error) {
+	return w.observe(context.Background(), "create_table", bucket, 0, func(context.Context) error {
+		return w.inner.CreateTable(bucket)
+	})
+}
+
+func (w *db) DeleteTable(bucket []byte) error {
+	return w.observe(context.Background(), "delete_table", bucket, 0, func(context.Context) error {
+		return w.inner.DeleteTable(bucket)
+	})
+}
+
+func (w *db) Buckets() (buckets [][]byte, err error) {
+	err = w.observe(context.Background(), "buckets", nil, 0, func(context.Context) error {
+		buckets, err = w.inner.Buckets()
+		return err
+	})
+	return buckets, err
+}
+
+func (w *db) Get(bucket []byte, key []byte) (val []byte, err error) {
+	err = w.observe(context.Background(), "get", bucket, len(key), func(context.Context) error {
+		val, err = w.inner.Get(bucket, key)
+		return err
+	})
+	return val, err
+}
+
+func (w *db) Set(bucket []byte, key []byte, value []byte) error {
+	return w.observe(context.Background(), "set", bucket, len(key), func(context.Context) error {
+		return w.inner.Set(bucket, key, value)
+	})
+}
+
+func (w *db) Del(bucket []byte, key []byte) error {
+	return w.observe(context.Background(), "del", bucket, len(key), func(context.Context) error {
+		return w.inner.Del(bucket, key)
+	})
+}
+
+func (w *db) List(bucket []byte) (entries []*database.Entry, err error) {
+	err = w.observe(context.Background(), "list", bucket, 0, func(context.Context) error {
+		entries, err = w.inner.List(bucket)
+		return err
+	})
+	return entries, err
+}
+
+func (w *db) Scan(bucket []byte, startKey []byte, endKey []byte, reverse bool, fn func(*database.Entry) error) error {
+	return w.observe(context.Background(), "scan", bucket, len(startKey), func(context.Context) error {
+		return w.inner.Scan(bucket, startKey, endKey, reverse, fn)
+	})
+}
+
+func (w *db) PrefixScan(bucket []byte, prefix []byte, fn func(*database.Entry) error) error {
+	return w.observe(context.Background(), "prefix_scan", bucket, len(prefix), func(context.Context) error {
+		return w.inner.PrefixScan(bucket, prefix, fn)
+	})
+}
+
+func (w *db) CmpAndSwap(bucket []byte, key []byte, oldValue []byte, newValue []byte) (val []byte, swapped bool, err error) {
+	err = w.observe(context.Background(), "cmp_and_swap", bucket, len(key), func(context.Context) error {
+		val, swapped, err = w.inner.CmpAndSwap(bucket, key, oldValue, newValue)
+		return err
+	})
+	return val, swapped, err
+}
+
+func (w *db) Update(ctx context.Context, tx *database.Tx) error {
+	return w.observe(ctx, "update", txBucket(tx), 0, func(ctx context.Context) error {
+		return w.inner.Update(ctx, tx)
+	})
+}
+
+func (w *db) View(ctx context.Context, tx *database.Tx) error {
+	return w.observe(ctx, "view", txBucket(tx), 0, func(ctx context.Context) error {
+		return w.inner.View(ctx, tx)
+	})
+}
+
+// txBucket returns tx's bucket label for metrics/spans: the single
+// bucket touched, if all operations agree, or "multi" otherwise.
+func txBucket(tx *database.Tx) []byte {
+	if len(tx.Operations) == 0 {
+		return nil
+	}
+	bucket := tx.Operations[0].Bucket
+	for _, op := range tx.Operations[1:] {
+		if string(op.Bucket) != string(bucket) {
+			return []byte("multi")
+		}
+	}
+	return bucket
+}
@@ -0,0 +1,125 @@
+package instrument_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/surajt6/nosql/database"
+	"github.com/surajt6/nosql/instrument"
+)
+
+// mockDB is a minimal database.DB that just records the context it
+// receives through Update/View; its data operations (Get, Set, Del, List,
+// Scan, PrefixScan, CmpAndSwap) return database.ErrOpNotSupported, and the
+// rest succeed without doing anything.
+type mockDB struct {
+	lastUpdateCtx context.Context
+	lastViewCtx   context.Context
+}
+
+func (m *mockDB) Open(string, ...database.Option) error  { return nil }
+func (m *mockDB) Close() error                           { return nil }
+func (m *mockDB) CreateTable([]byte) error               { return nil }
+func (m *mockDB) DeleteTable([]byte) error               { return nil }
+func (m *mockDB) Buckets() ([][]byte, error)             { return nil, nil }
+func (m *mockDB) Get([]byte, []byte) ([]byte, error)     { return nil, database.ErrOpNotSupported }
+func (m *mockDB) Set([]byte, []byte, []byte) error       { return database.ErrOpNotSupported }
+func (m *mockDB) Del([]byte, []byte) error               { return database.ErrOpNotSupported }
+func (m *mockDB) List([]byte) ([]*database.Entry, error) { return nil, database.ErrOpNotSupported }
+
+func (m *mockDB) Scan([]byte, []byte, []byte, bool, func(*database.Entry) error) error {
+	return database.ErrOpNotSupported
+}
+
+func (m *mockDB) PrefixScan([]byte, []byte, func(*database.Entry) error) error {
+	return database.ErrOpNotSupported
+}
+
+func (m *mockDB) CmpAndSwap([]byte, []byte, []byte, []byte) ([]byte, bool, error) {
+	return nil, false, database.ErrOpNotSupported
+}
+
+func (m *mockDB) Update(ctx context.Context, tx *database.Tx) error {
+	m.lastUpdateCtx = ctx
+	return nil
+}
+
+func (m *mockDB) View(ctx context.Context, tx *database.Tx) error {
+	m.lastViewCtx = ctx
+	return nil
+}
+
+// spanNameKey is the context key a recordingTracer stamps onto the context
+// it hands back from Start, so tests can tell whether a given context
+// descends from a particular span.
+type spanNameKey struct{}
+
+// recordingTracer is a trace.Tracer that stamps the span name onto the
+// context it returns from Start, and otherwise behaves like a no-op
+// tracer: it has no state of its own to verify, only the ability to prove
+// that the context it decorates is the one that reaches the wrapped call.
+type recordingTracer struct {
+	noop   trace.Tracer
+	starts []string
+}
+
+func (t *recordingTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.starts = append(t.starts, spanName)
+	ctx = context.WithValue(ctx, spanNameKey{}, spanName)
+	_, span := t.noop.Start(ctx, spanName, opts...)
+	return ctx, span
+}
+
+type recordingTracerProvider struct {
+	tracer *recordingTracer
+}
+
+func newRecordingTracerProvider() *recordingTracerProvider {
+	return &recordingTracerProvider{tracer: &recordingTracer{noop: trace.NewNoopTracerProvider().Tracer("test")}}
+}
+
+func (p *recordingTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+// TestWrapTwiceAgainstSameRegistererDoesNotPanic guards against the
+// MustRegister panic fixed alongside this test: wrapping a second DB with
+// the same Prometheus registerer must reuse the already-registered
+// collectors instead of panicking on a duplicate registration.
+func TestWrapTwiceAgainstSameRegistererDoesNotPanic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	instrument.Wrap(&mockDB{}, "mock", instrument.WithMetricsRegisterer(reg))
+	instrument.Wrap(&mockDB{}, "mock", instrument.WithMetricsRegisterer(reg))
+}
+
+// TestUpdateAndViewPropagateTheSpanContext guards against the regression
+// where Update/View's wrapped call received the caller's original context
+// instead of the span-decorated one observe creates, silently breaking
+// trace propagation into the inner driver.
+func TestUpdateAndViewPropagateTheSpanContext(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tp := newRecordingTracerProvider()
+	inner := &mockDB{}
+	w := instrument.Wrap(inner, "mock", instrument.WithMetricsRegisterer(reg), instrument.WithTracerProvider(tp))
+
+	ctx := context.Background()
+	tx := &database.Tx{Operations: []*database.TxEntry{{Cmd: database.Get, Bucket: []byte("b"), Key: []byte("k")}}}
+
+	if err := w.Update(ctx, tx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if name, _ := inner.lastUpdateCtx.Value(spanNameKey{}).(string); name != "nosql.update" {
+		t.Fatalf("inner.Update received a context stamped with span %q, want %q", name, "nosql.update")
+	}
+
+	if err := w.View(ctx, tx); err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if name, _ := inner.lastViewCtx.Value(spanNameKey{}).(string); name != "nosql.view" {
+		t.Fatalf("inner.View received a context stamped with span %q, want %q", name, "nosql.view")
+	}
+}
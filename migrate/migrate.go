@@ -0,0 +1,156 @@
+// Package migrate copies every bucket from one database.DB to another,
+// independent of which drivers are involved on each side.
+package migrate
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/surajt6/nosql/database"
+)
+
+// migrationStateBucket holds, per copied bucket, the last key that was
+// successfully written to dst so an interrupted Copy can resume instead of
+// starting over.
+var migrationStateBucket = []byte("_migration_state")
+
+// SkipPolicy controls what Copy does when a key already exists at the
+// destination.
+type SkipPolicy int
+
+const (
+	// Overwrite replaces the destination value with the source value.
+	Overwrite SkipPolicy = iota
+	// Skip leaves the destination value untouched.
+	Skip
+)
+
+// MigrateOptions configures a Copy run.
+type MigrateOptions struct {
+	// BatchSize is the number of entries written per destination
+	// transaction. Defaults to 500 when zero.
+	BatchSize int
+	// OnSkip controls the behavior when a key already exists at the
+	// destination.
+	OnSkip SkipPolicy
+	// Progress, when set, is called after every flushed batch with the
+	// running totals.
+	Progress func(Stats)
+}
+
+// Stats reports the outcome of a Copy run.
+type Stats struct {
+	Buckets int
+	Copied  int
+	Skipped int
+	Errors  int
+}
+
+// Copy walks every bucket in src (via src.Buckets) and streams its entries
+// to dst in batches of opts.BatchSize, recording a resumable checkpoint in
+// the _migration_state bucket on dst after every batch. Re-running Copy
+// with the same src/dst resumes each bucket after its last checkpointed
+// key instead of re-copying it from the start.
+func Copy(src database.DB, dst database.DB, opts MigrateOptions) (Stats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	var stats Stats
+
+	buckets, err := src.Buckets()
+	if err != nil {
+		return stats, errors.Wrap(err, "failed to list source buckets")
+	}
+
+	if err := dst.CreateTable(migrationStateBucket); err != nil {
+		return stats, errors.Wrap(err, "failed to create migration state bucket")
+	}
+
+	for _, bucket := range buckets {
+		if bytes.Equal(bucket, migrationStateBucket) {
+			continue
+		}
+		stats.Buckets++
+
+		if err := dst.CreateTable(bucket); err != nil {
+			return stats, errors.Wrapf(err, "failed to create destination bucket %s", bucket)
+		}
+
+		resumeKey, err := loadCheckpoint(dst, bucket)
+		if err != nil {
+			return stats, err
+		}
+
+		if err := copyBucket(src, dst, bucket, resumeKey, opts, &stats); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+func copyBucket(src, dst database.DB, bucket, resumeKey []byte, opts MigrateOptions, stats *Stats) error {
+	batch := make([]*database.TxEntry, 0, opts.BatchSize)
+	lastKey := resumeKey
+
+	flush := func(lastKey []byte) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ops := append(append([]*database.TxEntry{}, batch...), &database.TxEntry{
+			Cmd:    database.Set,
+			Bucket: migrationStateBucket,
+			Key:    bucket,
+			Value:  lastKey,
+		})
+		if err := dst.Update(context.Background(), &database.Tx{Operations: ops}); err != nil {
+			stats.Errors += len(batch)
+			return errors.Wrapf(err, "failed to write batch for bucket %s", bucket)
+		}
+		stats.Copied += len(batch)
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(*stats)
+		}
+		return nil
+	}
+
+	err := src.Scan(bucket, resumeKey, nil, false, func(e *database.Entry) error {
+		if resumeKey != nil && bytes.Equal(e.Key, resumeKey) {
+			return nil // already copied in a previous run
+		}
+		lastKey = e.Key
+		if opts.OnSkip == Skip {
+			if _, err := dst.Get(bucket, e.Key); err == nil {
+				stats.Skipped++
+				return nil
+			}
+		}
+		batch = append(batch, &database.TxEntry{Cmd: database.Set, Bucket: bucket, Key: e.Key, Value: e.Value})
+		if len(batch) >= opts.BatchSize {
+			return flush(e.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to scan source bucket %s", bucket)
+	}
+	// Record the actual last key the scan reached, not nil, or a
+	// terminal partial batch would overwrite a real checkpoint with one
+	// that tells the next Copy to start the bucket over from scratch.
+	return flush(lastKey)
+}
+
+func loadCheckpoint(dst database.DB, bucket []byte) ([]byte, error) {
+	key, err := dst.Get(migrationStateBucket, bucket)
+	switch {
+	case err == nil:
+		return key, nil
+	case database.IsErrNotFound(err):
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to load checkpoint for bucket %s", bucket)
+	}
+}
@@ -0,0 +1,239 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/surajt6/nosql/database"
+	"github.com/surajt6/nosql/migrate"
+)
+
+// mockDB is a minimal in-memory database.DB used to exercise Copy without
+// a real driver.
+type mockDB struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	// failAfter, if non-zero, makes Update fail starting with the
+	// failAfter'th call, to simulate a migration interrupted part way
+	// through a bucket.
+	failAfter int
+	updates   int
+}
+
+func newMockDB() *mockDB {
+	return &mockDB{buckets: map[string]map[string][]byte{}}
+}
+
+func (m *mockDB) Open(string, ...database.Option) error { return nil }
+func (m *mockDB) Close() error                          { return nil }
+
+func (m *mockDB) CreateTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[string(bucket)] == nil {
+		m.buckets[string(bucket)] = map[string][]byte{}
+	}
+	return nil
+}
+
+func (m *mockDB) DeleteTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets, string(bucket))
+	return nil
+}
+
+func (m *mockDB) Buckets() ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.buckets))
+	for name := range m.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buckets := make([][]byte, len(names))
+	for i, name := range names {
+		buckets[i] = []byte(name)
+	}
+	return buckets, nil
+}
+
+func (m *mockDB) Get(bucket, key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
+	}
+	return val, nil
+}
+
+func (m *mockDB) Set(bucket, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[string(bucket)] == nil {
+		m.buckets[string(bucket)] = map[string][]byte{}
+	}
+	m.buckets[string(bucket)][string(key)] = value
+	return nil
+}
+
+func (m *mockDB) Del(bucket, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets[string(bucket)], string(key))
+	return nil
+}
+
+func (m *mockDB) List(bucket []byte) ([]*database.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []*database.Entry
+	for key, value := range m.buckets[string(bucket)] {
+		entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(key), Value: value})
+	}
+	return entries, nil
+}
+
+func (m *mockDB) Scan(bucket, startKey, endKey []byte, reverse bool, fn func(*database.Entry) error) error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.buckets[string(bucket)]))
+	for key := range m.buckets[string(bucket)] {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+	sort.Strings(keys)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	for _, key := range keys {
+		if bytes.Compare([]byte(key), startKey) < 0 {
+			continue
+		}
+		if endKey != nil && bytes.Compare([]byte(key), endKey) >= 0 {
+			continue
+		}
+		m.mu.Lock()
+		value := m.buckets[string(bucket)][key]
+		m.mu.Unlock()
+		if err := fn(&database.Entry{Bucket: bucket, Key: []byte(key), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockDB) PrefixScan(bucket, prefix []byte, fn func(*database.Entry) error) error {
+	return m.Scan(bucket, prefix, nil, false, func(e *database.Entry) error {
+		if !bytes.HasPrefix(e.Key, prefix) {
+			return nil
+		}
+		return fn(e)
+	})
+}
+
+func (m *mockDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	return nil, false, database.ErrOpNotSupported
+}
+
+func (m *mockDB) Update(ctx context.Context, tx *database.Tx) error {
+	m.mu.Lock()
+	m.updates++
+	fail := m.failAfter != 0 && m.updates >= m.failAfter
+	m.mu.Unlock()
+	if fail {
+		return errors.New("mock: simulated write failure")
+	}
+	for _, q := range tx.Operations {
+		if q.Cmd != database.Set {
+			return database.ErrOpNotSupported
+		}
+		if err := m.Set(q.Bucket, q.Key, q.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockDB) View(ctx context.Context, tx *database.Tx) error {
+	return database.ErrOpNotSupported
+}
+
+var bucketA = []byte("a")
+
+func seed(t *testing.T, db *mockDB, bucket []byte, n int) {
+	t.Helper()
+	if err := db.CreateTable(bucket); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("k%03d", i))
+		if err := db.Set(bucket, key, []byte(fmt.Sprintf("v%03d", i))); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+}
+
+func TestCopyResumesAfterAnInterruptedBatch(t *testing.T) {
+	src := newMockDB()
+	seed(t, src, bucketA, 10)
+
+	dst := newMockDB()
+	// Fail the second destination write (the migration state bucket's
+	// CreateTable doesn't count as an Update, so this fails partway
+	// through copying bucketA).
+	dst.failAfter = 2
+
+	if _, err := migrate.Copy(src, dst, migrate.MigrateOptions{BatchSize: 3}); err == nil {
+		t.Fatal("Copy unexpectedly succeeded despite the simulated write failure")
+	}
+
+	dst.failAfter = 0
+	stats, err := migrate.Copy(src, dst, migrate.MigrateOptions{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("resumed Copy failed: %v", err)
+	}
+	if stats.Copied != 7 {
+		t.Fatalf("resumed Copy reported %d entries copied, want 7 (the 10 total minus the 3 already written and checkpointed on the first attempt)", stats.Copied)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("k%03d", i))
+		want := []byte(fmt.Sprintf("v%03d", i))
+		got, err := dst.Get(bucketA, key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// TestCopyResumeAfterCompletion guards against a terminal flush that
+// checkpoints a partial final batch with a nil key instead of the real
+// last key copied: if it did, re-running Copy against an already fully
+// copied bucket would start that bucket over from the beginning instead
+// of recognizing it as done.
+func TestCopyResumeAfterCompletion(t *testing.T) {
+	src := newMockDB()
+	seed(t, src, bucketA, 7) // not a multiple of BatchSize, so the final flush carries a partial batch.
+
+	dst := newMockDB()
+	if _, err := migrate.Copy(src, dst, migrate.MigrateOptions{BatchSize: 3}); err != nil {
+		t.Fatalf("first Copy failed: %v", err)
+	}
+
+	stats, err := migrate.Copy(src, dst, migrate.MigrateOptions{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("second Copy failed: %v", err)
+	}
+	if stats.Copied != 0 {
+		t.Fatalf("second Copy reported %d entries copied, want 0 (the bucket was already fully copied)", stats.Copied)
+	}
+}
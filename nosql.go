@@ -8,11 +8,17 @@ import (
 	badgerV2 "github.com/surajt6/nosql/badger/v2"
 	"github.com/surajt6/nosql/bolt"
 	"github.com/surajt6/nosql/database"
+	"github.com/surajt6/nosql/encrypted"
+	"github.com/surajt6/nosql/instrument"
 	"github.com/surajt6/nosql/mysql"
 	"github.com/surajt6/nosql/postgresql"
 	"github.com/surajt6/nosql/sqlite"
 )
 
+// encryptedDriverPrefix selects the encrypted wrapper driver; the rest of
+// the driver string names the inner driver to wrap, e.g. "encrypted+sqlite".
+const encryptedDriverPrefix = "encrypted+"
+
 // Option is just a wrapper over database.Option.
 type Option = database.Option
 
@@ -25,6 +31,23 @@ type Compactor interface {
 	Compact(discardRatio float64) error
 }
 
+// InstrumentOption is a wrapper over instrument.Option.
+type InstrumentOption = instrument.Option
+
+var (
+	// WithMetricsRegisterer is a wrapper over instrument.WithMetricsRegisterer.
+	WithMetricsRegisterer = instrument.WithMetricsRegisterer
+	// WithTracerProvider is a wrapper over instrument.WithTracerProvider.
+	WithTracerProvider = instrument.WithTracerProvider
+)
+
+// Instrument wraps db with Prometheus metrics and OpenTelemetry tracing;
+// driver should name the driver db was opened with (e.g. nosql.SQLiteDriver)
+// for the driver label on every metric and span.
+func Instrument(db database.DB, driver string, opt ...InstrumentOption) database.DB {
+	return instrument.Wrap(db, driver, opt...)
+}
+
 var (
 	// WithValueDir is a wrapper over database.WithValueDir.
 	WithValueDir = database.WithValueDir
@@ -32,6 +55,23 @@ var (
 	WithDatabase = database.WithDatabase
 	// WithBadgerFileLoadingMode is a wrapper over database.WithBadgerFileLoadingMode.
 	WithBadgerFileLoadingMode = database.WithBadgerFileLoadingMode
+	// WithMaxOpenConns is a wrapper over database.WithMaxOpenConns.
+	WithMaxOpenConns = database.WithMaxOpenConns
+	// WithMaxIdleConns is a wrapper over database.WithMaxIdleConns.
+	WithMaxIdleConns = database.WithMaxIdleConns
+	// WithConnMaxLifetime is a wrapper over database.WithConnMaxLifetime.
+	WithConnMaxLifetime = database.WithConnMaxLifetime
+	// WithConnMaxIdleTime is a wrapper over database.WithConnMaxIdleTime.
+	WithConnMaxIdleTime = database.WithConnMaxIdleTime
+	// WithSQLitePragma is a wrapper over database.WithSQLitePragma. It may
+	// be passed more than once to set several pragmas.
+	WithSQLitePragma = database.WithSQLitePragma
+	// WithEncryptionKey is a wrapper over database.WithEncryptionKey.
+	WithEncryptionKey = database.WithEncryptionKey
+	// WithEncryptionPassphrase is a wrapper over database.WithEncryptionPassphrase.
+	WithEncryptionPassphrase = database.WithEncryptionPassphrase
+	// WithEncryptKeys is a wrapper over database.WithEncryptKeys.
+	WithEncryptKeys = database.WithEncryptKeys
 	// IsErrNotFound is a wrapper over database.IsErrNotFound.
 	IsErrNotFound = database.IsErrNotFound
 	// IsErrOpNotSupported is a wrapper over database.IsErrOpNotSupported.
@@ -62,9 +102,17 @@ var (
 	BadgerFileIO = database.BadgerFileIO
 )
 
-// New returns a database with the given driver.
+// New returns a database with the given driver. A driver name prefixed
+// with "encrypted+" (e.g. "encrypted+sqlite") wraps the named inner driver
+// with the encrypted package's AES-GCM layer; see WithEncryptionKey and
+// WithEncryptionPassphrase.
 func New(driver, dataSourceName string, opt ...Option) (db database.DB, err error) {
-	switch strings.ToLower(driver) {
+	lower := strings.ToLower(driver)
+	if strings.HasPrefix(lower, encryptedDriverPrefix) {
+		return newEncrypted(strings.TrimPrefix(lower, encryptedDriverPrefix), dataSourceName, opt...)
+	}
+
+	switch lower {
 	case BadgerDriver, BadgerV1Driver:
 		db = &badgerV1.DB{}
 	case BadgerV2Driver:
@@ -83,3 +131,18 @@ func New(driver, dataSourceName string, opt ...Option) (db database.DB, err erro
 	err = db.Open(dataSourceName, opt...)
 	return
 }
+
+func newEncrypted(innerDriver, dataSourceName string, opt ...Option) (database.DB, error) {
+	inner, err := New(innerDriver, dataSourceName, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &database.Options{}
+	for _, o := range opt {
+		if err := o(opts); err != nil {
+			return nil, err
+		}
+	}
+	return encrypted.New(inner, opts.EncryptionKey, opts.EncryptionPassphrase, opts.EncryptKeys)
+}
@@ -2,8 +2,10 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -11,16 +13,65 @@ import (
 	"github.com/surajt6/nosql/database"
 )
 
-// DB is a wrapper over *sql.DB,
+// DB is a wrapper over *sql.DB. db is the writer handle used for
+// Set/Update/CmpAndSwap; roDB is a second, read-only handle used for
+// Get/List/Scan/Buckets/View so reads never queue behind WAL's single
+// writer.
 type DB struct {
-	db *sql.DB
+	db   *sql.DB
+	roDB *sql.DB
+}
+
+// reader returns the handle reads should go through: the dedicated
+// read-only handle if Open set one up, otherwise the writer handle.
+func (db *DB) reader() *sql.DB {
+	if db.roDB != nil {
+		return db.roDB
+	}
+	return db.db
 }
 
 // Close implements database.DB.
 func (db *DB) Close() error {
+	if db.roDB != nil {
+		if err := db.roDB.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	return errors.WithStack(db.db.Close())
 }
 
+// Stats implements the instrument.Wrap decorator's optional
+// statsProvider interface, surfacing sql.DB.Stats() for both the writer
+// and (if Open set one up) the dedicated read-only handle.
+func (db *DB) Stats() interface{} {
+	stats := map[string]sql.DBStats{"writer": db.db.Stats()}
+	if db.roDB != nil {
+		stats["reader"] = db.roDB.Stats()
+	}
+	return stats
+}
+
+// Buckets implements database.DB. It returns the name of every table in
+// the database, excluding sqlite's own bookkeeping tables.
+func (db *DB) Buckets() ([][]byte, error) {
+	rows, err := db.reader().Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing tables")
+	}
+	defer rows.Close()
+
+	var buckets [][]byte
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "error getting table name from row")
+		}
+		buckets = append(buckets, []byte(name))
+	}
+	return buckets, errors.Wrap(rows.Err(), "error accessing row")
+}
+
 // CmpAndSwap implements database.DB.
 func (db *DB) CmpAndSwap(bucket []byte, key []byte, oldValue []byte, newValue []byte) ([]byte, bool, error) {
 	sqlTx, err := db.db.Begin()
@@ -65,6 +116,22 @@ func cmpAndSwap(sqlTx *sql.Tx, bucket, key, oldValue, newValue []byte) ([]byte,
 	return newValue, true, nil
 }
 
+// cmpOrRollback compares the stored value at bucket/key against cmpValue
+// and returns database.ErrCmpFailed, wrapped with enough context to tell
+// callers which op failed, if they differ. A missing key is treated as a
+// value of nil.
+func cmpOrRollback(sqlTx *sql.Tx, bucket, key, cmpValue []byte) error {
+	var current []byte
+	err := sqlTx.QueryRow(getQryForUpdate(bucket), key).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(err, "failed to get %s/%s", bucket, key)
+	}
+	if !bytes.Equal(current, cmpValue) {
+		return errors.Wrapf(database.ErrCmpFailed, "%s/%s does not match the expected value", bucket, key)
+	}
+	return nil
+}
+
 // CreateTable implements database.DB.
 func (db *DB) CreateTable(bucket []byte) error {
 	_, err := db.db.Exec(createTableQry(bucket))
@@ -97,7 +164,7 @@ func (db *DB) DeleteTable(bucket []byte) error {
 // Get implements database.DB.
 func (db *DB) Get(bucket []byte, key []byte) (ret []byte, err error) {
 	var val string
-	err = db.db.QueryRow(getQry(bucket), key).Scan(&val)
+	err = db.reader().QueryRow(getQry(bucket), key).Scan(&val)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
@@ -110,7 +177,7 @@ func (db *DB) Get(bucket []byte, key []byte) (ret []byte, err error) {
 
 // List implements database.DB.
 func (db *DB) List(bucket []byte) ([]*database.Entry, error) {
-	rows, err := db.db.Query(fmt.Sprintf("SELECT * FROM `%s`", bucket))
+	rows, err := db.reader().Query(fmt.Sprintf("SELECT * FROM `%s`", bucket))
 	if err != nil {
 		estr := err.Error()
 		if strings.HasPrefix(estr, "no such table") {
@@ -141,6 +208,83 @@ func (db *DB) List(bucket []byte) ([]*database.Entry, error) {
 	return entries, nil
 }
 
+// Scan implements database.DB. It streams every entry in bucket whose key
+// falls in [startKey, endKey) to fn, in ascending order unless reverse is
+// set. A nil startKey means "no lower bound" and a nil endKey means "no
+// upper bound". Iteration stops at the first
+// error returned by fn.
+func (db *DB) Scan(bucket []byte, startKey []byte, endKey []byte, reverse bool, fn func(*database.Entry) error) error {
+	rows, err := db.reader().Query(scanQry(bucket, endKey != nil, reverse), scanArgs(startKey, endKey)...)
+	if err != nil {
+		estr := err.Error()
+		if strings.HasPrefix(estr, "no such table") {
+			return errors.Wrapf(database.ErrNotFound, estr)
+		}
+		return errors.Wrapf(err, "error scanning table %s", bucket)
+	}
+	defer rows.Close()
+
+	var key, value string
+	for rows.Next() {
+		if err := rows.Scan(&key, &value); err != nil {
+			return errors.Wrap(err, "error getting key and value from row")
+		}
+		if err := fn(&database.Entry{
+			Bucket: bucket,
+			Key:    []byte(key),
+			Value:  []byte(value),
+		}); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(rows.Err(), "error accessing row")
+}
+
+// PrefixScan is a convenience wrapper over Scan that iterates every entry
+// in bucket whose key starts with prefix, in ascending order.
+func (db *DB) PrefixScan(bucket []byte, prefix []byte, fn func(*database.Entry) error) error {
+	return db.Scan(bucket, prefix, prefixUpperBound(prefix), false, fn)
+}
+
+// prefixUpperBound returns the smallest key that is greater than every key
+// starting with prefix, or nil if prefix has no upper bound (e.g. it is
+// empty or made up entirely of 0xff bytes).
+func prefixUpperBound(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] != 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func scanArgs(startKey, endKey []byte) []interface{} {
+	if startKey == nil {
+		// A nil []byte is bound as NULL, and nkey >= NULL matches nothing;
+		// the empty blob sorts before every key.
+		startKey = []byte{}
+	}
+	if endKey != nil {
+		return []interface{}{startKey, endKey}
+	}
+	return []interface{}{startKey}
+}
+
+func scanQry(bucket []byte, hasEnd bool, reverse bool) string {
+	qry := fmt.Sprintf("SELECT nkey, nvalue FROM `%s` WHERE nkey >= ?", bucket)
+	if hasEnd {
+		qry += " AND nkey < ?"
+	}
+	if reverse {
+		qry += " ORDER BY nkey DESC"
+	} else {
+		qry += " ORDER BY nkey ASC"
+	}
+	return qry
+}
+
 // Open implements database.DB.
 func (db *DB) Open(dataSourceName string, opt ...database.Option) error {
 	opts := &database.Options{}
@@ -155,7 +299,17 @@ func (db *DB) Open(dataSourceName string, opt ...database.Option) error {
 	// 	opts.Database = parsedDSN.DBName
 	// }
 
-	_db, err := sql.Open("sqlite3", dataSourceName)
+	// Pragmas are passed as mattn/go-sqlite3 DSN query params (_busy_timeout,
+	// _journal_mode, ...) rather than a post-open PRAGMA Exec: database/sql
+	// pools can open further physical connections at any time, and an Exec
+	// against the handle only configures whichever single connection served
+	// it, leaving later connections on SQLite's defaults (no busy_timeout,
+	// rollback journal). DSN params are applied by the driver to every
+	// connection it opens.
+	pragmas := pragmasFromOptions(opts)
+	dsn := dsnWithPragmas(dataSourceName, pragmas)
+
+	_db, err := sql.Open("sqlite3", dsn)
 
 	if err != nil {
 		return errors.Wrap(err, "error connecting to sqlite3")
@@ -173,9 +327,69 @@ func (db *DB) Open(dataSourceName string, opt ...database.Option) error {
 	// 	return errors.Wrapf(err, "error connecting to mysql database")
 	// }
 
+	if opts.MaxOpenConns != 0 {
+		_db.SetMaxOpenConns(opts.MaxOpenConns)
+	} else if strings.EqualFold(pragmas["journal_mode"], "wal") {
+		// WAL allows only a single writer at a time; capping the writer pool
+		// to one connection turns lock contention into queueing instead of
+		// SQLITE_BUSY errors.
+		_db.SetMaxOpenConns(1)
+	}
+	if opts.MaxIdleConns != 0 {
+		_db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime != 0 {
+		_db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime != 0 {
+		_db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	// Unlike the writer, the reader pool is meant to grow with concurrent
+	// readers; it just needs every connection it opens to carry the same
+	// pragmas, which the shared dsn above guarantees, plus query_only so
+	// the handle cannot write.
+	roDB, err := sql.Open("sqlite3", dsn+"&_query_only=true")
+	if err != nil {
+		return errors.Wrap(err, "error opening read-only sqlite3 handle")
+	}
+	db.roDB = roDB
+
 	return nil
 }
 
+// pragmasFromOptions merges the driver's defaults (WAL journaling, a
+// busy_timeout high enough to ride out a writer holding the WAL lock, and
+// foreign keys on) with any caller-supplied overrides from
+// WithSQLitePragma.
+func pragmasFromOptions(opts *database.Options) map[string]string {
+	pragmas := map[string]string{
+		"journal_mode": "WAL",
+		"synchronous":  "NORMAL",
+		"busy_timeout": "5000",
+		"foreign_keys": "true",
+	}
+	for name, value := range opts.SQLitePragmas {
+		pragmas[name] = value
+	}
+	return pragmas
+}
+
+// dsnWithPragmas appends pragmas to dataSourceName as mattn/go-sqlite3 DSN
+// query params (one "_<pragma name>=<value>" per pragma), so every
+// connection the sql.DB pool opens picks them up, not just the first one.
+func dsnWithPragmas(dataSourceName string, pragmas map[string]string) string {
+	v := url.Values{}
+	for name, value := range pragmas {
+		v.Set("_"+name, value)
+	}
+	sep := "?"
+	if strings.Contains(dataSourceName, "?") {
+		sep = "&"
+	}
+	return dataSourceName + sep + v.Encode()
+}
+
 // Set implements database.DB.
 func (db *DB) Set(bucket []byte, key []byte, value []byte) error {
 	_, err := db.db.Exec(insertUpdateQry(bucket), key, value, value)
@@ -185,9 +399,41 @@ func (db *DB) Set(bucket []byte, key []byte, value []byte) error {
 	return nil
 }
 
+// View implements database.DB. It runs tx's operations in a read-only SQL
+// transaction; any operation other than database.Get fails with
+// database.ErrOpNotSupported instead of silently taking a write lock.
+func (db *DB) View(ctx context.Context, tx *database.Tx) error {
+	sqlTx, err := db.reader().BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	rollback := func(err error) error {
+		if rollbackErr := sqlTx.Rollback(); rollbackErr != nil {
+			return errors.Wrap(err, "VIEW failed, unable to rollback transaction")
+		}
+		return errors.Wrap(err, "VIEW failed")
+	}
+	for _, q := range tx.Operations {
+		if q.Cmd != database.Get {
+			return rollback(errors.Wrapf(database.ErrOpNotSupported, "%s is not allowed in a read-only View transaction", q.Cmd))
+		}
+		var val string
+		err := sqlTx.QueryRow(getQry(q.Bucket), q.Key).Scan(&val)
+		switch {
+		case err == sql.ErrNoRows:
+			return rollback(errors.Wrapf(database.ErrNotFound, "%s/%s not found", q.Bucket, q.Key))
+		case err != nil:
+			return rollback(errors.Wrapf(err, "failed to get %s/%s", q.Bucket, q.Key))
+		default:
+			q.Result = []byte(val)
+		}
+	}
+	return errors.WithStack(sqlTx.Commit())
+}
+
 // Update implements database.DB.
-func (db *DB) Update(tx *database.Tx) error {
-	sqlTx, err := db.db.Begin()
+func (db *DB) Update(ctx context.Context, tx *database.Tx) error {
+	sqlTx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -239,7 +485,9 @@ func (db *DB) Update(tx *database.Tx) error {
 				return rollback(errors.Wrapf(err, "failed to load-or-store %s/%s", q.Bucket, q.Key))
 			}
 		case database.CmpOrRollback:
-			return database.ErrOpNotSupported
+			if err := cmpOrRollback(sqlTx, q.Bucket, q.Key, q.CmpValue); err != nil {
+				return rollback(err)
+			}
 		default:
 			return database.ErrOpNotSupported
 		}